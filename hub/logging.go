@@ -0,0 +1,10 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger emits structured JSON logs so delivery and verification events can
+// be correlated by subscriber, topic and message id in production.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -1,27 +1,46 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"crypto/hmac"
-	"crypto/sha256"
+	"os"
 	"encoding/hex"
 	"crypto/rand"
 	"encoding/json"
-	"bytes"
-	"sync"
+	"strconv"
+	"time"
 )
 
-type subscriber struct {
-	callbackURL string
-	secret      string
-	topic       string
-}
-var verifiedSubscribersMutex sync.Mutex
-var verifiedSubscribers []subscriber
+const (
+	defaultLeaseSeconds = 10 * 24 * 60 * 60 // 10 days, same default most WebSub hubs use
+	pruneInterval       = time.Minute
+
+	// maxSecretLength is the maximum hub.secret length allowed by the
+	// WebSub spec.
+	maxSecretLength = 200
+
+	// maxVerificationResponseBytes caps how much of a subscriber's
+	// verification response the hub will read.
+	maxVerificationResponseBytes = 1 << 16 // 64 KiB
+
+	verificationTimeout = 10 * time.Second
+)
+
+// store is the backing SubscriberStore for the whole hub, selected in main
+// via the -store flag (or STORE_BACKEND env var).
+var store SubscriberStore
+
+// verificationHTTPClient is used for the verification-of-intent GET; it has
+// a strict timeout so a slow or unresponsive callback can't tie up a
+// verification goroutine indefinitely, and dials through safeDialContext so
+// a callback that's repointed its DNS after subscribing can't bypass the
+// SSRF check performed at subscribe time.
+var verificationHTTPClient = newSafeHTTPClient(verificationTimeout)
 
 func getSubscriberRequest(w http.ResponseWriter, r *http.Request) {
 	// Make sure that the method and URL path are correct.
@@ -30,69 +49,193 @@ func getSubscriberRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rateLimited(w, r) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
 	bodyParsed, err := parseRequestBody(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	mode := bodyParsed.Get("hub.mode")
 	callbackURL := bodyParsed.Get("hub.callback")
 	secret := bodyParsed.Get("hub.secret")
 	topic := bodyParsed.Get("hub.topic")
 
-	// Validate parsed data
-	if callbackURL == "" || topic == "" || secret == "" {
+	// Validate parsed data. hub.secret isn't required to unsubscribe: only
+	// the callback's challenge response authorizes that, per WebSub.
+	if callbackURL == "" || topic == "" || (secret == "" && mode != "unsubscribe") {
 		http.Error(w, "Missing subscriber data", http.StatusBadRequest)
 		return
 	}
 
-	newSubscriber := subscriber{callbackURL: callbackURL, secret: secret, topic: topic}
+	if len(secret) > maxSecretLength {
+		http.Error(w, "hub.secret exceeds the maximum allowed length", http.StatusBadRequest)
+		return
+	}
+
+	if !isTopicAllowed(topic) {
+		http.Error(w, "Topic is not in the allowlist", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCallbackURL(callbackURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sigAlgorithm := bodyParsed.Get("hub.signature_algorithm")
+	if sigAlgorithm == "" {
+		sigAlgorithm = defaultSigAlgorithm
+	}
+	if !supportedSigAlgorithms[sigAlgorithm] {
+		http.Error(w, "Unsupported hub.signature_algorithm", http.StatusBadRequest)
+		return
+	}
+
+	switch mode {
+	case "", "subscribe":
+		mode = "subscribe"
+	case "unsubscribe":
+		// no-op, handled below
+	default:
+		http.Error(w, "Unsupported hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	leaseSeconds := defaultLeaseSeconds
+	if raw := bodyParsed.Get("hub.lease_seconds"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid hub.lease_seconds", http.StatusBadRequest)
+			return
+		}
+		leaseSeconds = parsed
+	}
 
+	newSubscriber := subscriber{
+		callbackURL:  callbackURL,
+		secret:       secret,
+		topic:        topic,
+		expiresAt:    time.Now().Add(time.Duration(leaseSeconds) * time.Second),
+		sigAlgorithm: sigAlgorithm,
+	}
+
+	// Only reserve a pending-verification slot once every synchronous
+	// validation has passed, so a request that's rejected outright (bad
+	// signature algorithm, mode, or lease_seconds) can never leak a slot.
+	if !acquirePendingVerification() {
+		http.Error(w, "Too many pending verifications, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	subscriptionRequestsTotal.Inc()
 	fmt.Fprint(w, "Subscription request received.")
-	 
-	verifySubscriber(newSubscriber)
+
+	if mode == "unsubscribe" {
+		go verifyUnsubscribe(newSubscriber)
+	} else {
+		go verifySubscriber(newSubscriber, leaseSeconds)
+	}
+}
+
+func verifySubscriber(sub subscriber, leaseSeconds int) {
+	defer releasePendingVerification()
+	logger.Info("verifying subscriber", "callback", sub.callbackURL, "topic", sub.topic)
+
+	if !doVerificationHandshake(sub, "subscribe", leaseSeconds) {
+		verificationsTotal.WithLabelValues("failure").Inc()
+		logger.Warn("verification failed", "callback", sub.callbackURL, "topic", sub.topic)
+		return
+	}
+
+	verificationsTotal.WithLabelValues("success").Inc()
+	logger.Info("subscriber verified", "callback", sub.callbackURL, "topic", sub.topic)
+	if err := store.Add(sub); err != nil {
+		logger.Error("failed to persist subscriber", "callback", sub.callbackURL, "topic", sub.topic, "error", err)
+	}
 }
 
-func verifySubscriber(sub subscriber) {
-	log.Printf("Verifying subscriber: %s", sub.callbackURL)
-	
+func verifyUnsubscribe(sub subscriber) {
+	defer releasePendingVerification()
+	logger.Info("verifying unsubscribe", "callback", sub.callbackURL, "topic", sub.topic)
+
+	if !doVerificationHandshake(sub, "unsubscribe", 0) {
+		verificationsTotal.WithLabelValues("failure").Inc()
+		logger.Warn("unsubscribe verification failed", "callback", sub.callbackURL, "topic", sub.topic)
+		return
+	}
+
+	verificationsTotal.WithLabelValues("success").Inc()
+	logger.Info("subscriber unsubscribed", "callback", sub.callbackURL, "topic", sub.topic)
+	if err := store.Remove(sub.callbackURL, sub.topic); err != nil {
+		logger.Error("failed to remove subscriber", "callback", sub.callbackURL, "topic", sub.topic, "error", err)
+	}
+}
+
+// doVerificationHandshake performs the verification-of-intent GET described by
+// the WebSub spec and reports whether the subscriber echoed the challenge back
+// with a 2xx response.
+func doVerificationHandshake(sub subscriber, mode string, leaseSeconds int) bool {
 	challenge, err := generateRandomString(16)
 	if err != nil {
-		log.Printf("Error generating challenge for verification: %v", err)
-		return
+		logger.Error("failed to generate verification challenge", "callback", sub.callbackURL, "error", err)
+		return false
 	}
 
 	values := url.Values{}
-	values.Set("hub.mode", "subscribe")
+	values.Set("hub.mode", mode)
 	values.Set("hub.topic", sub.topic)
 	values.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		values.Set("hub.lease_seconds", strconv.Itoa(leaseSeconds))
+	}
 
 	verificationURL := fmt.Sprintf("%s?%s", sub.callbackURL, values.Encode())
 
-	resp, err := http.Get(verificationURL)
+	resp, err := verificationHTTPClient.Get(verificationURL)
 	if err != nil {
-		log.Printf("Error sending verification request to %s: %v", sub.callbackURL, err)
-		return
+		logger.Error("verification request failed", "callback", sub.callbackURL, "error", err)
+		return false
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warn("verification request rejected", "callback", sub.callbackURL, "status_code", resp.StatusCode)
+		return false
+	}
 
-	// The subscriber echos back the challenge
-	body, err := ioutil.ReadAll(resp.Body)
+	// The subscriber echos back the challenge. Cap how much we read so a
+	// malicious or misbehaving callback can't exhaust hub memory.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxVerificationResponseBytes))
 	if err != nil {
-		log.Printf("Error reading response from subscriber %s: %v", sub.callbackURL, err)
-		return
+		logger.Error("failed to read verification response", "callback", sub.callbackURL, "error", err)
+		return false
 	}
-	
-	if string(body) != challenge {
-		log.Printf("Verification failed for subscriber: %s", sub.callbackURL)
-	} else {
-		log.Printf("Subscriber verified: %s", sub.callbackURL)
-		verifiedSubscribersMutex.Lock()
-		verifiedSubscribers = append(verifiedSubscribers, sub)
-		verifiedSubscribersMutex.Unlock()
+
+	return string(body) == challenge
+}
+
+// pruneExpiredSubscribers runs for the lifetime of the process, periodically
+// removing subscribers whose lease has elapsed without renewal.
+func pruneExpiredSubscribers() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := store.PruneExpired(time.Now())
+		if err != nil {
+			logger.Error("failed to prune expired subscribers", "error", err)
+			continue
+		}
+		for _, sub := range expired {
+			logger.Info("subscription lease expired", "callback", sub.callbackURL, "topic", sub.topic)
+		}
 	}
-	
 }
 
 func parseRequestBody(r *http.Request) (url.Values, error) {
@@ -114,6 +257,13 @@ func parseRequestBody(r *http.Request) (url.Values, error) {
     return bodyParsed, nil
 }
 
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func generateRandomString(n int) (string, error) {
 	bytes := make([]byte, n)
 	if _, err := rand.Read(bytes); err != nil {
@@ -122,74 +272,78 @@ func generateRandomString(n int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func publishContent(w http.ResponseWriter, r *http.Request) {
-	// Check if the HTTP method is GET
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-        return
-    }
+type publishRequest struct {
+	Topic   string `json:"topic"`
+	Content string `json:"content"`
+}
 
-    // Define the JSON content
-    data := map[string]string{
-        "message": "New content available",
-    }
-    jsonData, err := json.Marshal(data)
-    if err != nil {
-        log.Printf("Error marshaling JSON: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
-    }
+func publishContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	verifiedSubscribersMutex.Lock()
+	if rateLimited(w, r) {
+		return
+	}
 
-	verifiedSubsCopy:= make([]subscriber, len(verifiedSubscribers))
-	copy(verifiedSubsCopy, verifiedSubscribers)
-	
-	verifiedSubscribersMutex.Unlock()
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	topic := r.URL.Query().Get("topic")
+	content := ""
+
+	if r.Header.Get("Content-Type") == "application/json" {
+		var parsed publishRequest
+		if err := json.NewDecoder(r.Body).Decode(&parsed); err != nil && err != io.EOF {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if parsed.Topic != "" {
+			topic = parsed.Topic
+		}
+		content = parsed.Content
+	}
 
-    // Iterate over all verified subscribers and send them the signed content
-    for _, sub := range verifiedSubsCopy {
-		go func (sub subscriber)  {
-			signature := createSignature(sub.secret, string(jsonData))
-			sendSignedContent(sub, jsonData, signature)
-		}(sub)	
-    }
+	if topic == "" {
+		http.Error(w, "Missing topic", http.StatusBadRequest)
+		return
+	}
 
-    fmt.Fprintf(w, "Content published to %d verified subscribers.\n", len(verifiedSubsCopy))
-}
+	if content == "" {
+		if fetched, err := fetchTopicContent(topic); err == nil {
+			content = string(fetched)
+		} else {
+			content = "New content available"
+		}
+	}
 
-func sendSignedContent(sub subscriber, jsonData []byte, signature string) {
-    client := &http.Client{}
-    
-	req, err := http.NewRequest("POST", sub.callbackURL, bytes.NewReader(jsonData))
-    
+	jsonData, err := json.Marshal(map[string]string{"message": content})
 	if err != nil {
-        log.Printf("Failed to create request for subscriber %s: %v", sub.callbackURL, err)
-        return
-    }
-
-    // Add the signature and Content-Type headers
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("X-Hub-Signature", fmt.Sprintf("sha256=%s", signature))
+		logger.Error("failed to marshal publish content", "topic", topic, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-    // Send the request
-    resp, err := client.Do(req)
-    if err != nil {
-        log.Printf("Error sending signed content to subscriber %s: %v", sub.callbackURL, err)
-        return
-    }
-    defer resp.Body.Close()
+	subs, err := store.List()
+	if err != nil {
+		logger.Error("failed to list subscribers for publish", "topic", topic, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-    log.Printf("Signed content sent to subscriber %s, response status: %d", sub.callbackURL, resp.StatusCode)
-	fetchSubscriberLogs()
-}
+	// Queue a delivery only for subscribers of the published topic; the
+	// bounded worker pool in retry.go does the actual sending (and
+	// retrying on failure).
+	delivered := 0
+	for _, sub := range subs {
+		if sub.topic != topic {
+			continue
+		}
+		enqueueDelivery(sub, jsonData, maxDeliveryFailures)
+		delivered++
+	}
 
-func createSignature(secret string, message string) string{
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write([]byte(message))
-	signature := mac.Sum(nil)
-	
-	return hex.EncodeToString(signature)
+	fmt.Fprintf(w, "Content published to %d verified subscribers of topic %q.\n", delivered, topic)
 }
 
 func initiateSubscriptionDance(w http.ResponseWriter, r *http.Request) {
@@ -200,41 +354,76 @@ func initiateSubscriptionDance(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := http.Get("http://web-sub-client:8080" +"/resub")
 	if err != nil {
-		log.Printf("Error initiating subscription dance: %v", err)
+		logger.Error("failed to initiate subscription dance", "error", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
-		log.Println("Subscription dance initiated successfully.")
+		logger.Info("subscription dance initiated successfully")
 	} else {
-		log.Printf("Failed to initiate subscription dance, status code: %d", resp.StatusCode)
+		logger.Warn("failed to initiate subscription dance", "status_code", resp.StatusCode)
 	}
 }
 
 func fetchSubscriberLogs() {
 	resp, err := http.Get("http://web-sub-client:8080" + "/log")
 	if err != nil {
-		log.Printf("Error fetching subscriber logs: %v", err)
+		logger.Error("failed to fetch subscriber logs", "error", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Error reading subscriber logs response body: %v", err)
+		logger.Error("failed to read subscriber logs response", "error", err)
 		return
 	}
-	log.Println("___________")
-	log.Printf("Subscriber logs:\n%s", string(body))
-	log.Println("___________")
+	logger.Info("subscriber logs", "body", string(body))
+}
+
+// initStore builds the SubscriberStore selected by -store (or STORE_BACKEND),
+// defaulting to the in-memory backend so the hub still runs unconfigured.
+func initStore(backend, sqlitePath string) SubscriberStore {
+	switch backend {
+	case "", "memory":
+		return newMemoryStore()
+	case "sqlite":
+		s, err := newSQLiteStore(sqlitePath)
+		if err != nil {
+			log.Fatalf("Failed to open sqlite store at %s: %v", sqlitePath, err)
+		}
+		return s
+	default:
+		log.Fatalf("Unknown store backend %q, want \"memory\" or \"sqlite\"", backend)
+		return nil
+	}
 }
 
 func main() {
+	storeBackend := flag.String("store", envOrDefault("STORE_BACKEND", "memory"), "subscriber store backend: memory or sqlite")
+	sqlitePath := flag.String("sqlite-path", envOrDefault("SQLITE_PATH", "hub.db"), "path to the sqlite database file when -store=sqlite")
+	deliveryWorkers := flag.Int("delivery-workers", defaultDeliveryWorkers, "number of concurrent delivery workers")
+	flag.IntVar(&maxDeliveryFailures, "max-delivery-failures", defaultMaxDeliveryFailures, "consecutive delivery failures before a subscriber is auto-unsubscribed")
+	allowedTopics := flag.String("allowed-topics", envOrDefault("ALLOWED_TOPICS", "*"), "comma separated list of hub.topic values to accept, or * to allow any (dev only)")
+	topicContentURLs := flag.String("topic-content-urls", envOrDefault("TOPIC_CONTENT_URLS", ""), "comma separated topic=url pairs the hub can fetch content from on publish")
+	flag.BoolVar(&allowPrivateCallbacks, "dev-allow-private-callbacks", false, "allow hub.callback URLs that resolve to private/loopback/link-local addresses (dev only)")
+	flag.Parse()
+
+	store = initStore(*storeBackend, *sqlitePath)
+	startDeliveryWorkers(*deliveryWorkers)
+	configureTopics(*allowedTopics, *topicContentURLs)
+
+	go pruneExpiredSubscribers()
+	go watchActiveSubscribers()
+	go cleanupVisitors()
+
 	http.HandleFunc("/", getSubscriberRequest)
 	http.HandleFunc("/publish", publishContent)
+	http.HandleFunc("/topics", listTopicsRequest)
 	http.HandleFunc("/resub", initiateSubscriptionDance)
-	
+	registerMetricsEndpoint()
+
 
 	port := "8080"
 	log.Printf("Starting server on port %s...", port)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	subscriptionRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "websub_hub_subscription_requests_total",
+		Help: "Total number of subscription requests received on /.",
+	})
+
+	verificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "websub_hub_verifications_total",
+		Help: "Total number of verification-of-intent handshakes, by result.",
+	}, []string{"result"})
+
+	deliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "websub_hub_deliveries_total",
+		Help: "Total number of content delivery attempts, by result and response status code.",
+	}, []string{"result", "status_code"})
+
+	deliveryLatencySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "websub_hub_delivery_latency_seconds",
+		Help:    "Latency of delivery attempts to subscriber callbacks.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	activeSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "websub_hub_active_subscribers",
+		Help: "Current number of verified subscribers.",
+	})
+
+	retryQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "websub_hub_retry_queue_depth",
+		Help: "Current number of deliveries queued for (re)delivery.",
+	})
+)
+
+// watchActiveSubscribers keeps the activeSubscribers gauge in sync with the
+// store, for the lifetime of the process.
+func watchActiveSubscribers() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		subs, err := store.List()
+		if err != nil {
+			logger.Error("failed to list subscribers for metrics", "error", err)
+			continue
+		}
+		activeSubscribers.Set(float64(len(subs)))
+	}
+}
+
+func registerMetricsEndpoint() {
+	http.Handle("/metrics", promhttp.Handler())
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// visitorRateLimit and visitorBurst bound how many subscription
+	// requests a single IP can make; tuned to tolerate a legitimate
+	// subscriber retrying a handful of times without opening the hub up
+	// to abuse.
+	visitorRateLimit = 1 // requests per second, sustained
+	visitorBurst     = 5
+
+	visitorExpiry        = 3 * time.Minute
+	visitorCleanupPeriod = time.Minute
+
+	// maxPendingVerifications caps how many verification-of-intent GETs
+	// can be in flight at once, so a burst of subscription requests can't
+	// turn the hub into an outbound request amplifier.
+	maxPendingVerifications = 100
+
+	// maxRequestBodyBytes bounds the size of incoming subscription and
+	// publish request bodies.
+	maxRequestBodyBytes = 1 << 20 // 1 MiB
+)
+
+var pendingVerifications = make(chan struct{}, maxPendingVerifications)
+
+// acquirePendingVerification reserves a slot for an in-flight verification
+// GET, reporting false if the hub already has maxPendingVerifications
+// outstanding.
+func acquirePendingVerification() bool {
+	select {
+	case pendingVerifications <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releasePendingVerification() {
+	<-pendingVerifications
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+var (
+	visitorsMu sync.Mutex
+	visitors   = map[string]*visitor{}
+)
+
+func getVisitor(ip string) *rate.Limiter {
+	visitorsMu.Lock()
+	defer visitorsMu.Unlock()
+
+	v, ok := visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(visitorRateLimit, visitorBurst)}
+		visitors[ip] = v
+	}
+	v.lastSeen = time.Now()
+	return v.limiter
+}
+
+// cleanupVisitors runs for the lifetime of the process, forgetting visitors
+// that haven't made a request in a while so the map doesn't grow unbounded.
+func cleanupVisitors() {
+	ticker := time.NewTicker(visitorCleanupPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		visitorsMu.Lock()
+		for ip, v := range visitors {
+			if time.Since(v.lastSeen) > visitorExpiry {
+				delete(visitors, ip)
+			}
+		}
+		visitorsMu.Unlock()
+	}
+}
+
+// clientIP extracts the caller's IP from RemoteAddr, stripping the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimited reports whether the request's IP has exceeded its token
+// bucket, writing a 429 response if so.
+func rateLimited(w http.ResponseWriter, r *http.Request) bool {
+	limiter := getVisitor(clientIP(r))
+	if limiter.Allow() {
+		return false
+	}
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	return true
+}
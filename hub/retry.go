@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// backoffSchedule is the delay before each retry attempt, indexed by
+// (attempt - 1). The last entry is reused for any attempt beyond its index.
+var backoffSchedule = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+}
+
+const maxBackoff = 24 * time.Hour
+
+// deliveryTimeout bounds how long a single delivery attempt can take, so a
+// slow or hanging subscriber callback can't tie up a worker (and, in turn,
+// the bounded deliveryQueue) indefinitely.
+const deliveryTimeout = 10 * time.Second
+
+// defaultMaxDeliveryFailures is how many consecutive delivery failures a
+// subscriber tolerates before it is automatically unsubscribed.
+const defaultMaxDeliveryFailures = 10
+
+// defaultDeliveryWorkers bounds how many deliveries run concurrently so a
+// slow or unreachable subscriber can't spawn unbounded goroutines.
+const defaultDeliveryWorkers = 10
+
+var nextMessageID uint64
+
+// deliveryHTTPClient is used for content delivery and retries; like
+// verificationHTTPClient it dials through safeDialContext so a subscriber
+// can't pass the subscribe-time SSRF check and later repoint DNS at a
+// private address to receive deliveries there instead.
+var deliveryHTTPClient = newSafeHTTPClient(deliveryTimeout)
+
+// maxDeliveryFailures is set once from main via the -max-delivery-failures flag.
+var maxDeliveryFailures = defaultMaxDeliveryFailures
+
+// deliveryJob is one attempt (or retry) at delivering content to a subscriber.
+type deliveryJob struct {
+	sub         subscriber
+	jsonData    []byte
+	messageID   uint64
+	attempt     int
+	maxFailures int
+}
+
+var deliveryQueue chan deliveryJob
+
+// startDeliveryWorkers launches the bounded worker pool that drains
+// deliveryQueue. It must be called once before any job is enqueued.
+func startDeliveryWorkers(workers int) {
+	if workers <= 0 {
+		workers = defaultDeliveryWorkers
+	}
+	deliveryQueue = make(chan deliveryJob, workers*4)
+	for i := 0; i < workers; i++ {
+		go deliveryWorker()
+	}
+}
+
+func deliveryWorker() {
+	for job := range deliveryQueue {
+		retryQueueDepth.Dec()
+		sendSignedContent(job)
+	}
+}
+
+// enqueueDelivery submits the first delivery attempt for a subscriber.
+func enqueueDelivery(sub subscriber, jsonData []byte, maxFailures int) {
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxDeliveryFailures
+	}
+	retryQueueDepth.Inc()
+	deliveryQueue <- deliveryJob{
+		sub:         sub,
+		jsonData:    jsonData,
+		messageID:   atomic.AddUint64(&nextMessageID, 1),
+		attempt:     1,
+		maxFailures: maxFailures,
+	}
+}
+
+func backoffFor(attempt int) time.Duration {
+	idx := attempt - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(backoffSchedule) {
+		return maxBackoff
+	}
+	return backoffSchedule[idx]
+}
+
+func sendSignedContent(job deliveryJob) {
+	sub := job.sub
+	algorithm := sub.sigAlgorithm
+	if algorithm == "" {
+		algorithm = defaultSigAlgorithm
+	}
+	signature := createSignature(sub.secret, string(job.jsonData), algorithm)
+
+	client := deliveryHTTPClient
+
+	req, err := http.NewRequest("POST", sub.callbackURL, bytes.NewReader(job.jsonData))
+	if err != nil {
+		logger.Error("failed to create delivery request", "callback", sub.callbackURL, "topic", sub.topic, "message_id", job.messageID, "error", err)
+		recordDeliveryFailure(job, err.Error())
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Signature-256", fmt.Sprintf("%s=%s", algorithm, signature))
+	if algorithm == "sha1" {
+		// Legacy header kept for subscribers that only understand the
+		// original WebSub sha1 signature.
+		req.Header.Set("X-Hub-Signature", fmt.Sprintf("sha1=%s", signature))
+	}
+	req.Header.Set("X-Hub-Message-Id", fmt.Sprintf("%d", job.messageID))
+	req.Header.Set("Retry-Count", fmt.Sprintf("%d", job.attempt-1))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	deliveryLatencySeconds.Observe(time.Since(start).Seconds())
+	if err != nil {
+		logger.Error("delivery request failed", "callback", sub.callbackURL, "topic", sub.topic, "message_id", job.messageID, "error", err)
+		deliveriesTotal.WithLabelValues("failure", "none").Inc()
+		recordDeliveryFailure(job, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	statusCode := fmt.Sprintf("%d", resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warn("delivery rejected by subscriber", "callback", sub.callbackURL, "topic", sub.topic, "message_id", job.messageID, "status_code", resp.StatusCode)
+		deliveriesTotal.WithLabelValues("failure", statusCode).Inc()
+		recordDeliveryFailure(job, fmt.Sprintf("status %d", resp.StatusCode))
+		return
+	}
+
+	logger.Info("delivery succeeded", "callback", sub.callbackURL, "topic", sub.topic, "message_id", job.messageID, "status_code", resp.StatusCode)
+	deliveriesTotal.WithLabelValues("success", statusCode).Inc()
+	recordDeliverySuccess(sub)
+	fetchSubscriberLogs()
+}
+
+// recordDeliveryFailure updates the subscriber's failure count, schedules a
+// retry with exponential backoff, and unsubscribes the callback once
+// maxFailures consecutive failures have been observed.
+func recordDeliveryFailure(job deliveryJob, errMsg string) {
+	sub := job.sub
+	sub.failureCount++
+	sub.lastError = errMsg
+
+	if sub.failureCount >= job.maxFailures {
+		logger.Warn("subscriber exceeded max consecutive delivery failures, unsubscribing",
+			"callback", sub.callbackURL, "topic", sub.topic, "failure_count", sub.failureCount, "max_failures", job.maxFailures)
+		if err := store.Remove(sub.callbackURL, sub.topic); err != nil {
+			logger.Error("failed to remove failing subscriber", "callback", sub.callbackURL, "topic", sub.topic, "error", err)
+		}
+		return
+	}
+
+	if err := store.Add(sub); err != nil {
+		logger.Error("failed to persist delivery failure", "callback", sub.callbackURL, "topic", sub.topic, "error", err)
+	}
+
+	delay := backoffFor(job.attempt)
+	retryJob := deliveryJob{
+		sub:         sub,
+		jsonData:    job.jsonData,
+		messageID:   job.messageID,
+		attempt:     job.attempt + 1,
+		maxFailures: job.maxFailures,
+	}
+	retryQueueDepth.Inc()
+	time.AfterFunc(delay, func() {
+		deliveryQueue <- retryJob
+	})
+}
+
+func recordDeliverySuccess(sub subscriber) {
+	sub.failureCount = 0
+	sub.lastError = ""
+	sub.lastDeliveryAt = time.Now()
+	if err := store.Add(sub); err != nil {
+		logger.Error("failed to persist delivery success", "callback", sub.callbackURL, "topic", sub.topic, "error", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffFor(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 30 * time.Second}, // treated the same as attempt 1
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: 2 * time.Minute},
+		{attempt: 3, want: 10 * time.Minute},
+		{attempt: 4, want: time.Hour},
+		{attempt: 5, want: 6 * time.Hour},
+		{attempt: 6, want: maxBackoff},
+		{attempt: 100, want: maxBackoff},
+	}
+
+	for _, c := range cases {
+		if got := backoffFor(c.attempt); got != c.want {
+			t.Errorf("backoffFor(%d) = %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
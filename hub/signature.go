@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+)
+
+// defaultSigAlgorithm is used when a subscriber doesn't request one via
+// hub.signature_algorithm.
+const defaultSigAlgorithm = "sha256"
+
+// supportedSigAlgorithms are the hash algorithms the hub can sign deliveries
+// with, per the WebSub spec's negotiable-algorithm guidance.
+var supportedSigAlgorithms = map[string]bool{
+	"sha1":   true,
+	"sha256": true,
+	"sha384": true,
+	"sha512": true,
+}
+
+func hasherFor(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "sha1":
+		return sha1.New
+	case "sha384":
+		return sha512.New384
+	case "sha512":
+		return sha512.New
+	default:
+		return sha256.New
+	}
+}
+
+// createSignature computes the hex-encoded HMAC of message under the given
+// algorithm ("sha1", "sha256", "sha384" or "sha512"), defaulting to sha256.
+func createSignature(secret, message, algorithm string) string {
+	mac := hmac.New(hasherFor(algorithm), []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
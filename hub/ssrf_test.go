@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestValidateCallbackURL(t *testing.T) {
+	cases := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "public IP", url: "https://8.8.8.8/callback", wantErr: false},
+		{name: "loopback", url: "http://127.0.0.1/callback", wantErr: true},
+		{name: "private", url: "http://10.0.0.1/callback", wantErr: true},
+		{name: "link-local", url: "http://169.254.1.1/callback", wantErr: true},
+		{name: "unspecified", url: "http://0.0.0.0/callback", wantErr: true},
+		{name: "wrong scheme", url: "ftp://8.8.8.8/callback", wantErr: true},
+		{name: "missing host", url: "http:///callback", wantErr: true},
+		{name: "not a URL", url: "://", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateCallbackURL(c.url)
+			if (err != nil) != c.wantErr {
+				t.Errorf("validateCallbackURL(%q) error = %v, wantErr %v", c.url, err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCallbackURLAllowsPrivateInDevMode(t *testing.T) {
+	allowPrivateCallbacks = true
+	defer func() { allowPrivateCallbacks = false }()
+
+	if err := validateCallbackURL("http://127.0.0.1/callback"); err != nil {
+		t.Errorf("validateCallbackURL with allowPrivateCallbacks=true: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriber is a single WebSub subscription: one (callback, topic) pair and
+// the bookkeeping needed to verify, renew, and retry delivery to it.
+type subscriber struct {
+	callbackURL    string
+	secret         string
+	topic          string
+	expiresAt      time.Time
+	failureCount   int
+	lastDeliveryAt time.Time
+	lastError      string
+	sigAlgorithm   string
+}
+
+// SubscriberStore persists verified subscribers so the hub can survive
+// restarts and, eventually, run as more than one instance.
+type SubscriberStore interface {
+	Add(sub subscriber) error
+	Remove(callbackURL, topic string) error
+	List() ([]subscriber, error)
+	FindByCallbackAndTopic(callbackURL, topic string) (subscriber, bool, error)
+	PruneExpired(now time.Time) ([]subscriber, error)
+}
+
+// memoryStore is the original in-process storage, kept as the default so the
+// hub still runs with no configuration.
+type memoryStore struct {
+	mu   sync.Mutex
+	subs []subscriber
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Add(sub subscriber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.subs {
+		if existing.callbackURL == sub.callbackURL && existing.topic == sub.topic {
+			s.subs[i] = sub
+			return nil
+		}
+	}
+	s.subs = append(s.subs, sub)
+	return nil
+}
+
+func (s *memoryStore) Remove(callbackURL, topic string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.subs {
+		if existing.callbackURL == callbackURL && existing.topic == topic {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) List() ([]subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]subscriber, len(s.subs))
+	copy(out, s.subs)
+	return out, nil
+}
+
+func (s *memoryStore) FindByCallbackAndTopic(callbackURL, topic string) (subscriber, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.subs {
+		if existing.callbackURL == callbackURL && existing.topic == topic {
+			return existing, true, nil
+		}
+	}
+	return subscriber{}, false, nil
+}
+
+func (s *memoryStore) PruneExpired(now time.Time) ([]subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []subscriber
+	kept := s.subs[:0]
+	for _, sub := range s.subs {
+		if sub.expiresAt.After(now) {
+			kept = append(kept, sub)
+		} else {
+			expired = append(expired, sub)
+		}
+	}
+	s.subs = kept
+	return expired, nil
+}
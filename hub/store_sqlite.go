@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore persists subscribers in a SQLite database so subscription
+// state survives process restarts.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(dbPath string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS subscribers (
+		callback_url     TEXT NOT NULL,
+		topic            TEXT NOT NULL,
+		secret           TEXT NOT NULL,
+		expires_at       DATETIME NOT NULL,
+		failure_count    INTEGER NOT NULL DEFAULT 0,
+		last_delivery_at DATETIME,
+		last_error       TEXT,
+		sig_algorithm    TEXT NOT NULL DEFAULT 'sha256',
+		PRIMARY KEY (callback_url, topic)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Add(sub subscriber) error {
+	_, err := s.db.Exec(`INSERT INTO subscribers (callback_url, topic, secret, expires_at, failure_count, last_delivery_at, last_error, sig_algorithm)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(callback_url, topic) DO UPDATE SET
+			secret = excluded.secret,
+			expires_at = excluded.expires_at,
+			failure_count = excluded.failure_count,
+			last_delivery_at = excluded.last_delivery_at,
+			last_error = excluded.last_error,
+			sig_algorithm = excluded.sig_algorithm`,
+		sub.callbackURL, sub.topic, sub.secret, sub.expiresAt, sub.failureCount, sub.lastDeliveryAt, sub.lastError, sub.sigAlgorithm)
+	return err
+}
+
+func (s *sqliteStore) Remove(callbackURL, topic string) error {
+	_, err := s.db.Exec(`DELETE FROM subscribers WHERE callback_url = ? AND topic = ?`, callbackURL, topic)
+	return err
+}
+
+func (s *sqliteStore) List() ([]subscriber, error) {
+	rows, err := s.db.Query(`SELECT callback_url, topic, secret, expires_at, failure_count, last_delivery_at, last_error, sig_algorithm FROM subscribers`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSubscribers(rows)
+}
+
+func (s *sqliteStore) FindByCallbackAndTopic(callbackURL, topic string) (subscriber, bool, error) {
+	row := s.db.QueryRow(`SELECT callback_url, topic, secret, expires_at, failure_count, last_delivery_at, last_error, sig_algorithm
+		FROM subscribers WHERE callback_url = ? AND topic = ?`, callbackURL, topic)
+
+	var sub subscriber
+	var lastDelivery sql.NullTime
+	var lastError sql.NullString
+	err := row.Scan(&sub.callbackURL, &sub.topic, &sub.secret, &sub.expiresAt, &sub.failureCount, &lastDelivery, &lastError, &sub.sigAlgorithm)
+	if err == sql.ErrNoRows {
+		return subscriber{}, false, nil
+	}
+	if err != nil {
+		return subscriber{}, false, err
+	}
+	if lastDelivery.Valid {
+		sub.lastDeliveryAt = lastDelivery.Time
+	}
+	if lastError.Valid {
+		sub.lastError = lastError.String
+	}
+	return sub, true, nil
+}
+
+func (s *sqliteStore) PruneExpired(now time.Time) ([]subscriber, error) {
+	rows, err := s.db.Query(`SELECT callback_url, topic, secret, expires_at, failure_count, last_delivery_at, last_error, sig_algorithm
+		FROM subscribers WHERE expires_at <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	expired, err := scanSubscribers(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM subscribers WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+func scanSubscribers(rows *sql.Rows) ([]subscriber, error) {
+	var out []subscriber
+	for rows.Next() {
+		var sub subscriber
+		var lastDelivery sql.NullTime
+		var lastError sql.NullString
+		if err := rows.Scan(&sub.callbackURL, &sub.topic, &sub.secret, &sub.expiresAt, &sub.failureCount, &lastDelivery, &lastError, &sub.sigAlgorithm); err != nil {
+			return nil, err
+		}
+		if lastDelivery.Valid {
+			sub.lastDeliveryAt = lastDelivery.Time
+		}
+		if lastError.Valid {
+			sub.lastError = lastError.String
+		}
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// storeFactories lets the round-trip tests below run against every
+// SubscriberStore implementation without duplicating the test bodies.
+func storeFactories(t *testing.T) map[string]SubscriberStore {
+	t.Helper()
+	sqlite, err := newSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("newSQLiteStore: %v", err)
+	}
+	return map[string]SubscriberStore{
+		"memoryStore": newMemoryStore(),
+		"sqliteStore": sqlite,
+	}
+}
+
+func TestStoreAddFindRemove(t *testing.T) {
+	for name, store := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			sub := subscriber{
+				callbackURL:  "https://example.com/callback",
+				secret:       "s3cr3t",
+				topic:        "news",
+				expiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+				sigAlgorithm: "sha256",
+			}
+
+			if err := store.Add(sub); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+
+			got, ok, err := store.FindByCallbackAndTopic(sub.callbackURL, sub.topic)
+			if err != nil {
+				t.Fatalf("FindByCallbackAndTopic: %v", err)
+			}
+			if !ok {
+				t.Fatal("FindByCallbackAndTopic: subscriber not found after Add")
+			}
+			if got.secret != sub.secret || got.sigAlgorithm != sub.sigAlgorithm || !got.expiresAt.Equal(sub.expiresAt) {
+				t.Fatalf("FindByCallbackAndTopic returned %+v, want %+v", got, sub)
+			}
+
+			if err := store.Remove(sub.callbackURL, sub.topic); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+
+			if _, ok, err := store.FindByCallbackAndTopic(sub.callbackURL, sub.topic); err != nil {
+				t.Fatalf("FindByCallbackAndTopic after Remove: %v", err)
+			} else if ok {
+				t.Fatal("FindByCallbackAndTopic: subscriber still present after Remove")
+			}
+		})
+	}
+}
+
+func TestStoreAddUpsertsExistingSubscriber(t *testing.T) {
+	for name, store := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			sub := subscriber{callbackURL: "https://example.com/callback", topic: "news", secret: "old", expiresAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+			if err := store.Add(sub); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+
+			sub.secret = "new"
+			if err := store.Add(sub); err != nil {
+				t.Fatalf("Add (update): %v", err)
+			}
+
+			subs, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(subs) != 1 {
+				t.Fatalf("List returned %d subscribers, want 1 (Add should upsert, not duplicate)", len(subs))
+			}
+			if subs[0].secret != "new" {
+				t.Fatalf("List()[0].secret = %q, want %q", subs[0].secret, "new")
+			}
+		})
+	}
+}
+
+func TestStorePruneExpired(t *testing.T) {
+	for name, store := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().Truncate(time.Second)
+			expired := subscriber{callbackURL: "https://example.com/a", topic: "news", expiresAt: now.Add(-time.Minute)}
+			active := subscriber{callbackURL: "https://example.com/b", topic: "news", expiresAt: now.Add(time.Hour)}
+
+			if err := store.Add(expired); err != nil {
+				t.Fatalf("Add expired: %v", err)
+			}
+			if err := store.Add(active); err != nil {
+				t.Fatalf("Add active: %v", err)
+			}
+
+			pruned, err := store.PruneExpired(now)
+			if err != nil {
+				t.Fatalf("PruneExpired: %v", err)
+			}
+			if len(pruned) != 1 || pruned[0].callbackURL != expired.callbackURL {
+				t.Fatalf("PruneExpired returned %+v, want only %q", pruned, expired.callbackURL)
+			}
+
+			remaining, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(remaining) != 1 || remaining[0].callbackURL != active.callbackURL {
+				t.Fatalf("List after PruneExpired returned %+v, want only %q", remaining, active.callbackURL)
+			}
+		})
+	}
+}
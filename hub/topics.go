@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// wildcardTopic, when present in the allowlist, permits any hub.topic value.
+// It's meant for local/dev use, not production hubs.
+const wildcardTopic = "*"
+
+// topicRegistry tracks which topics the hub will accept subscriptions for
+// and, optionally, a content URL the hub can fetch on a subscriber's behalf.
+type topicRegistry struct {
+	mu          sync.Mutex
+	allowlist   map[string]bool
+	wildcard    bool
+	contentURLs map[string]string
+}
+
+var topics = &topicRegistry{
+	allowlist:   map[string]bool{},
+	contentURLs: map[string]string{},
+}
+
+// configureTopics parses the -allowed-topics and -topic-content-urls flags
+// into the registry. allowedTopics is a comma separated list of topic names,
+// or "*" to allow any topic. topicContentURLs is a comma separated list of
+// topic=url pairs.
+func configureTopics(allowedTopics, topicContentURLs string) {
+	topics.mu.Lock()
+	defer topics.mu.Unlock()
+
+	for _, topic := range strings.Split(allowedTopics, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if topic == wildcardTopic {
+			topics.wildcard = true
+			continue
+		}
+		topics.allowlist[topic] = true
+	}
+
+	for _, pair := range strings.Split(topicContentURLs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("Ignoring malformed -topic-content-urls entry: %q", pair)
+			continue
+		}
+		topics.contentURLs[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+}
+
+func isTopicAllowed(topic string) bool {
+	topics.mu.Lock()
+	defer topics.mu.Unlock()
+	if topics.wildcard {
+		return true
+	}
+	return topics.allowlist[topic]
+}
+
+func contentURLForTopic(topic string) (string, bool) {
+	topics.mu.Lock()
+	defer topics.mu.Unlock()
+	url, ok := topics.contentURLs[topic]
+	return url, ok
+}
+
+// fetchTopicContent retrieves the current content for a topic from its
+// configured content URL, for hubs that publish by reference rather than by
+// pushing the payload directly.
+func fetchTopicContent(topic string) ([]byte, error) {
+	contentURL, ok := contentURLForTopic(topic)
+	if !ok {
+		return nil, fmt.Errorf("no content URL configured for topic %q", topic)
+	}
+
+	resp, err := http.Get(contentURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching content for topic %q: %w", topic, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading content for topic %q: %w", topic, err)
+	}
+	return body, nil
+}
+
+// listTopicsRequest is the GET /topics admin endpoint: it reports every known
+// topic (from the allowlist, the content URL map, and current subscribers)
+// along with how many verified subscribers each one has.
+func listTopicsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	subs, err := store.List()
+	if err != nil {
+		log.Printf("Error listing subscribers for /topics: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	counts := map[string]int{}
+	for _, sub := range subs {
+		counts[sub.topic]++
+	}
+
+	topics.mu.Lock()
+	for topic := range topics.allowlist {
+		if _, ok := counts[topic]; !ok {
+			counts[topic] = 0
+		}
+	}
+	for topic := range topics.contentURLs {
+		if _, ok := counts[topic]; !ok {
+			counts[topic] = 0
+		}
+	}
+	topics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(counts); err != nil {
+		log.Printf("Error encoding /topics response: %v", err)
+	}
+}